@@ -0,0 +1,226 @@
+package dns
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheShardCount is the number of independent LRU shards the cache is
+// split across, so that concurrent lookups for different names don't
+// contend on the same mutex (see BenchmarkServerThroughput).
+const cacheShardCount = 256
+
+// cacheKey identifies one RRset: a lowercased, undotted QNAME plus
+// QTYPE and QCLASS.
+type cacheKey struct {
+	name  string
+	qtype uint16
+	class uint16
+}
+
+func cacheKeyFor(q DNSQuestion) cacheKey {
+	return cacheKey{name: strings.ToLower(strings.TrimSuffix(q.Name, ".")), qtype: q.Type, class: q.Class}
+}
+
+type cacheEntry struct {
+	wire        []byte
+	insertedTTL uint32
+	expiry      time.Time
+}
+
+type cacheShard struct {
+	mu    sync.RWMutex
+	cap   int
+	items map[cacheKey]*list.Element
+	order *list.List // front = most recently used
+}
+
+type cacheNode struct {
+	key   cacheKey
+	entry cacheEntry
+}
+
+func newCacheShard(capacity int) *cacheShard {
+	return &cacheShard{
+		cap:   capacity,
+		items: make(map[cacheKey]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (s *cacheShard) get(key cacheKey) (cacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	s.order.MoveToFront(el)
+	return el.Value.(*cacheNode).entry, true
+}
+
+// set inserts or updates key, evicting the least-recently-used entry
+// if the shard is now over capacity. It reports whether an eviction
+// happened.
+func (s *cacheShard) set(key cacheKey, entry cacheEntry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		el.Value.(*cacheNode).entry = entry
+		s.order.MoveToFront(el)
+		return false
+	}
+
+	el := s.order.PushFront(&cacheNode{key: key, entry: entry})
+	s.items[key] = el
+	if s.order.Len() <= s.cap {
+		return false
+	}
+
+	oldest := s.order.Back()
+	s.order.Remove(oldest)
+	delete(s.items, oldest.Value.(*cacheNode).key)
+	return true
+}
+
+// Cache is an in-memory, sharded LRU cache of DNS responses, keyed by
+// question and honoring the TTLs of the RRsets it stores.
+type Cache struct {
+	shards [cacheShardCount]*cacheShard
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// NewCache builds a Cache sized to hold roughly size entries in total,
+// spread evenly across its shards.
+func NewCache(size int) *Cache {
+	perShard := size / cacheShardCount
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	c := &Cache{}
+	for i := range c.shards {
+		c.shards[i] = newCacheShard(perShard)
+	}
+	return c
+}
+
+func (c *Cache) shardFor(name string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return c.shards[h.Sum32()%cacheShardCount]
+}
+
+// Get returns a response to question carrying id as its message ID,
+// if a live entry exists. Each record's TTL is decremented by the time
+// elapsed since insertion, clamped at zero.
+//
+// The response is the original wire bytes received from upstream,
+// with only the ID and TTL fields patched in place: it is never
+// re-Packed from the parsed message, since that would re-run owner-name
+// compression and could invalidate a compression pointer embedded in
+// some record's RDATA (valid only relative to the exact bytes it was
+// received in).
+func (c *Cache) Get(question DNSQuestion, id uint16) ([]byte, bool) {
+	key := cacheKeyFor(question)
+	shard := c.shardFor(key.name)
+
+	entry, ok := shard.get(key)
+	if !ok || !time.Now().Before(entry.expiry) {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	elapsedTTL := entry.insertedTTL - uint32(time.Until(entry.expiry).Seconds())
+	response, err := adjustWireTTLs(entry.wire, func(ttl uint32) uint32 {
+		if elapsedTTL >= ttl {
+			return 0
+		}
+		return ttl - elapsedTTL
+	})
+	if err != nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+	binary.BigEndian.PutUint16(response[0:2], id)
+
+	c.hits.Add(1)
+	return response, true
+}
+
+// Set caches wire, the original wire-format response, against msg (its
+// already-parsed form, so the RCODE and TTLs don't need reparsing) if
+// its RCODE is NOERROR or NXDOMAIN, keyed by its first question. The
+// stored TTL is the minimum across every returned RRset or, for a
+// negative answer, the authority section's SOA MINIMUM (RFC 2308's
+// negative-cache TTL).
+func (c *Cache) Set(wire []byte, msg *DNSMessage) {
+	if len(msg.Questions) == 0 {
+		return
+	}
+
+	rcode := msg.Header.Flags & 0x000F
+	if rcode != RCodeNoError && rcode != RCodeNXDomain {
+		return
+	}
+
+	ttl, ok := minTTL(msg)
+	if !ok {
+		return
+	}
+
+	key := cacheKeyFor(msg.Questions[0])
+	entry := cacheEntry{
+		wire:        append([]byte(nil), wire...),
+		insertedTTL: ttl,
+		expiry:      time.Now().Add(time.Duration(ttl) * time.Second),
+	}
+	if c.shardFor(key.name).set(key, entry) {
+		c.evictions.Add(1)
+	}
+}
+
+// minTTL returns the minimum TTL across msg's answers, or, if there
+// are none (a negative answer), the SOA MINIMUM from its authority
+// section.
+func minTTL(msg *DNSMessage) (uint32, bool) {
+	min, found := minRecordTTL(msg.Answers)
+	if found {
+		return min, true
+	}
+
+	for _, rec := range msg.Authority {
+		if rec.Type != QTypeSOA || len(rec.RData) < 4 {
+			continue
+		}
+		soaMinimum := binary.BigEndian.Uint32(rec.RData[len(rec.RData)-4:])
+		if !found || soaMinimum < min {
+			min, found = soaMinimum, true
+		}
+	}
+	return min, found
+}
+
+func minRecordTTL(records []DNSRecord) (uint32, bool) {
+	var min uint32
+	found := false
+	for _, rec := range records {
+		if rec.Type == QTypeOPT {
+			continue
+		}
+		if !found || rec.TTL < min {
+			min, found = rec.TTL, true
+		}
+	}
+	return min, found
+}
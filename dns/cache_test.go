@@ -0,0 +1,125 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSetAndGet(t *testing.T) {
+	c := NewCache(1024)
+
+	msg := &DNSMessage{
+		Header:    DNSHeader{ID: 1, QDCount: 1, ANCount: 1, Flags: FlagResponse},
+		Questions: []DNSQuestion{{Name: "example.com", Type: QTypeA, Class: QClassIN}},
+		Answers:   []DNSRecord{{Name: "example.com", Type: QTypeA, Class: QClassIN, TTL: 300, RDLength: 4, RData: []byte{1, 2, 3, 4}}},
+	}
+	wire, err := msg.Pack()
+	require.NoError(t, err)
+	c.Set(wire, msg)
+
+	packed, ok := c.Get(DNSQuestion{Name: "EXAMPLE.com.", Type: QTypeA, Class: QClassIN}, 42)
+	require.True(t, ok)
+
+	parsed, err := ParseDNSMessage(packed)
+	require.NoError(t, err)
+	require.Equal(t, uint16(42), parsed.Header.ID)
+	require.Len(t, parsed.Answers, 1)
+	require.LessOrEqual(t, parsed.Answers[0].TTL, uint32(300))
+}
+
+func TestCacheMissForUnknownQuestion(t *testing.T) {
+	c := NewCache(1024)
+	_, ok := c.Get(DNSQuestion{Name: "unknown.com", Type: QTypeA, Class: QClassIN}, 1)
+	require.False(t, ok)
+}
+
+func TestCacheDoesNotStoreServerFailure(t *testing.T) {
+	c := NewCache(1024)
+	msg := &DNSMessage{
+		Header:    DNSHeader{ID: 1, QDCount: 1, Flags: FlagResponse | 2}, // RCODE 2 = SERVFAIL
+		Questions: []DNSQuestion{{Name: "example.com", Type: QTypeA, Class: QClassIN}},
+	}
+	wire, err := msg.Pack()
+	require.NoError(t, err)
+	c.Set(wire, msg)
+
+	_, ok := c.Get(DNSQuestion{Name: "example.com", Type: QTypeA, Class: QClassIN}, 1)
+	require.False(t, ok)
+}
+
+func TestCacheNegativeTTLFromSOAMinimum(t *testing.T) {
+	c := NewCache(1024)
+
+	soaRData := make([]byte, 0, 24)
+	soaRData = append(soaRData, encodeDomainName("ns.example.com")...)
+	soaRData = append(soaRData, encodeDomainName("admin.example.com")...)
+	var fields [20]byte
+	// SERIAL, REFRESH, RETRY, EXPIRE, MINIMUM=60
+	fields[19] = 60
+	soaRData = append(soaRData, fields[:]...)
+
+	msg := &DNSMessage{
+		Header:    DNSHeader{ID: 1, QDCount: 1, Flags: FlagResponse | RCodeNXDomain},
+		Questions: []DNSQuestion{{Name: "missing.example.com", Type: QTypeA, Class: QClassIN}},
+		Authority: []DNSRecord{{Name: "example.com", Type: QTypeSOA, Class: QClassIN, TTL: 3600, RDLength: uint16(len(soaRData)), RData: soaRData}},
+	}
+	wire, err := msg.Pack()
+	require.NoError(t, err)
+	c.Set(wire, msg)
+
+	_, ok := c.Get(DNSQuestion{Name: "missing.example.com", Type: QTypeA, Class: QClassIN}, 1)
+	require.True(t, ok)
+}
+
+func TestCacheEntryExpires(t *testing.T) {
+	c := NewCache(1024)
+	msg := &DNSMessage{
+		Header:    DNSHeader{ID: 1, QDCount: 1, ANCount: 1, Flags: FlagResponse},
+		Questions: []DNSQuestion{{Name: "example.com", Type: QTypeA, Class: QClassIN}},
+		Answers:   []DNSRecord{{Name: "example.com", Type: QTypeA, Class: QClassIN, TTL: 0, RDLength: 4, RData: []byte{1, 2, 3, 4}}},
+	}
+	wire, err := msg.Pack()
+	require.NoError(t, err)
+	c.Set(wire, msg)
+
+	time.Sleep(10 * time.Millisecond)
+	_, ok := c.Get(DNSQuestion{Name: "example.com", Type: QTypeA, Class: QClassIN}, 1)
+	require.False(t, ok)
+}
+
+func TestCacheShardEviction(t *testing.T) {
+	c := NewCache(cacheShardCount) // one entry per shard
+
+	shard := c.shardFor("a.example.com")
+	shard.cap = 1
+
+	msgA := &DNSMessage{
+		Header:    DNSHeader{ID: 1, QDCount: 1, ANCount: 1, Flags: FlagResponse},
+		Questions: []DNSQuestion{{Name: "a.example.com", Type: QTypeA, Class: QClassIN}},
+		Answers:   []DNSRecord{{Name: "a.example.com", Type: QTypeA, Class: QClassIN, TTL: 300, RDLength: 4, RData: []byte{1, 1, 1, 1}}},
+	}
+	msgB := &DNSMessage{
+		Header:    DNSHeader{ID: 1, QDCount: 1, ANCount: 1, Flags: FlagResponse},
+		Questions: []DNSQuestion{{Name: "b.example.com", Type: QTypeA, Class: QClassIN}},
+		Answers:   []DNSRecord{{Name: "b.example.com", Type: QTypeA, Class: QClassIN, TTL: 300, RDLength: 4, RData: []byte{2, 2, 2, 2}}},
+	}
+
+	if c.shardFor("a.example.com") != c.shardFor("b.example.com") {
+		t.Skip("a and b landed in different shards for this hash; eviction isn't exercised")
+	}
+
+	wireA, err := msgA.Pack()
+	require.NoError(t, err)
+	wireB, err := msgB.Pack()
+	require.NoError(t, err)
+	c.Set(wireA, msgA)
+	c.Set(wireB, msgB)
+
+	_, ok := c.Get(DNSQuestion{Name: "a.example.com", Type: QTypeA, Class: QClassIN}, 1)
+	require.False(t, ok, "oldest entry should have been evicted")
+
+	_, ok = c.Get(DNSQuestion{Name: "b.example.com", Type: QTypeA, Class: QClassIN}, 1)
+	require.True(t, ok)
+}
@@ -0,0 +1,234 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// healthDecay is the weight given to an upstream's history versus its
+// latest sample when updating the EWMA latency/error-rate estimates.
+const healthDecay = 0.8
+
+const defaultForwardTimeout = 5 * time.Second
+
+// UpstreamConfig names one forwarding target and how long the
+// Forwarder waits before racing it against upstreams that were
+// started earlier. Addr is passed to NewUpstream, so it may be a bare
+// "host:port" (plain UDP) or a scheme URL such as "tls://host:853".
+type UpstreamConfig struct {
+	Addr       string
+	StartDelay time.Duration
+}
+
+// Forwarder fans a query out to a set of upstreams, starting each one
+// after its StartDelay, and returns the first well-formed reply
+// (matching the query ID, QR bit set), cancelling the rest. This
+// mirrors Tailscale's "resolvers with delays" forwarder: the StartDelay
+// ladder is continuously reassigned by observed per-upstream health,
+// so fast, reliable upstreams end up queried first.
+type Forwarder struct {
+	mu        sync.Mutex
+	upstreams []*upstreamHealth
+	timeout   time.Duration
+}
+
+// upstreamHealth tracks a single upstream's EWMA latency and error
+// rate alongside its static configuration and resolved transport.
+type upstreamHealth struct {
+	UpstreamConfig
+	transport Upstream
+
+	mu      sync.Mutex
+	ewmaRTT time.Duration
+	ewmaErr float64 // 0..1
+}
+
+func (u *upstreamHealth) record(rtt time.Duration, err error) {
+	sample := 0.0
+	if err != nil {
+		sample = 1.0
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.ewmaRTT == 0 {
+		u.ewmaRTT = rtt
+	} else {
+		u.ewmaRTT = time.Duration(healthDecay*float64(u.ewmaRTT) + (1-healthDecay)*float64(rtt))
+	}
+	u.ewmaErr = healthDecay*u.ewmaErr + (1-healthDecay)*sample
+}
+
+func (u *upstreamHealth) score() (rtt time.Duration, errRate float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.ewmaRTT, u.ewmaErr
+}
+
+// rankedUpstream is an upstreamHealth with its StartDelay reassigned
+// according to the current health ranking.
+type rankedUpstream struct {
+	*upstreamHealth
+	StartDelay time.Duration
+}
+
+// NewForwarder builds a Forwarder over configs, resolving each Addr to
+// an Upstream transport via NewUpstream. An upstream whose Addr can't
+// be resolved to a transport (an unknown scheme) always fails its
+// exchanges, rather than making construction itself fallible.
+func NewForwarder(configs []UpstreamConfig) *Forwarder {
+	f := &Forwarder{timeout: defaultForwardTimeout}
+	for _, c := range configs {
+		transport, err := NewUpstream(c.Addr)
+		if err != nil {
+			transport = erroringUpstream{err: err}
+		}
+		f.upstreams = append(f.upstreams, &upstreamHealth{UpstreamConfig: c, transport: transport})
+	}
+	return f
+}
+
+// addrs returns the configured upstream addresses, for logging.
+func (f *Forwarder) addrs() []string {
+	out := make([]string, len(f.upstreams))
+	for i, u := range f.upstreams {
+		out[i] = u.Addr
+	}
+	return out
+}
+
+// Close releases every upstream's transport (e.g. persistent DoT
+// connections).
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var firstErr error
+	for _, u := range f.upstreams {
+		if err := u.transport.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ranked returns the upstreams sorted by health (lowest error rate,
+// then lowest latency, first), each carrying the configured StartDelay
+// values reassigned in that order so the healthiest upstream always
+// gets the smallest delay.
+func (f *Forwarder) ranked() []rankedUpstream {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	byHealth := make([]*upstreamHealth, len(f.upstreams))
+	copy(byHealth, f.upstreams)
+	sort.SliceStable(byHealth, func(i, j int) bool {
+		rttI, errI := byHealth[i].score()
+		rttJ, errJ := byHealth[j].score()
+		if errI != errJ {
+			return errI < errJ
+		}
+		return rttI < rttJ
+	})
+
+	delays := make([]time.Duration, len(f.upstreams))
+	for i, u := range f.upstreams {
+		delays[i] = u.StartDelay
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+
+	ranked := make([]rankedUpstream, len(byHealth))
+	for i, u := range byHealth {
+		ranked[i] = rankedUpstream{upstreamHealth: u, StartDelay: delays[i]}
+	}
+	return ranked
+}
+
+// Forward races query against all configured upstreams and returns the
+// first well-formed response, cancelling the others.
+func (f *Forwarder) Forward(query []byte) ([]byte, error) {
+	if len(query) < 2 {
+		return nil, fmt.Errorf("query too short")
+	}
+	queryID := binary.BigEndian.Uint16(query[0:2])
+
+	ordered := f.ranked()
+	if len(ordered) == 0 {
+		return nil, fmt.Errorf("no upstreams configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	type result struct {
+		resp []byte
+		err  error
+	}
+	results := make(chan result, len(ordered))
+
+	var wg sync.WaitGroup
+	for _, u := range ordered {
+		u := u
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			timer := time.NewTimer(u.StartDelay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			start := time.Now()
+			resp, err := u.transport.Exchange(ctx, query)
+			u.record(time.Since(start), err)
+			if err == nil && !isWellFormedResponse(resp, queryID) {
+				err = fmt.Errorf("malformed response from %s", u.Addr)
+			}
+
+			select {
+			case results <- result{resp, err}:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var lastErr error
+	for r := range results {
+		if r.err == nil {
+			cancel()
+			return r.resp, nil
+		}
+		lastErr = r.err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("all upstreams failed")
+	}
+	return nil, lastErr
+}
+
+// isWellFormedResponse reports whether resp looks like a genuine reply
+// to the query carrying queryID: long enough to have a header, same
+// ID, and the QR (response) bit set.
+func isWellFormedResponse(resp []byte, queryID uint16) bool {
+	if len(resp) < DNSHeaderSize {
+		return false
+	}
+	id := binary.BigEndian.Uint16(resp[0:2])
+	flags := binary.BigEndian.Uint16(resp[2:4])
+	return id == queryID && flags&FlagResponse != 0
+}
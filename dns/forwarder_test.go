@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockForwarderWithDelay behaves like mockForwarder but waits delay
+// before replying, so tests can exercise the Forwarder's racing
+// behavior against multiple upstreams.
+func mockForwarderWithDelay(t *testing.T, responseToSend []byte, delay time.Duration) *net.UDPAddr {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		_, remoteAddr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		time.Sleep(delay)
+		conn.WriteToUDP(responseToSend, remoteAddr)
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+func TestForwarderRacesUpstreamsAndReturnsFastest(t *testing.T) {
+	query := &DNSMessage{Header: DNSHeader{ID: 42, QDCount: 1}, Questions: []DNSQuestion{{Name: "test.com", Type: QTypeA, Class: QClassIN}}}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	slowResp := &DNSMessage{Header: DNSHeader{ID: 42, ANCount: 1, Flags: FlagResponse}, Answers: []DNSRecord{{Name: "test.com", RData: []byte{1, 1, 1, 1}}}}
+	slowBytes, err := slowResp.Pack()
+	require.NoError(t, err)
+
+	fastResp := &DNSMessage{Header: DNSHeader{ID: 42, ANCount: 1, Flags: FlagResponse}, Answers: []DNSRecord{{Name: "test.com", RData: []byte{2, 2, 2, 2}}}}
+	fastBytes, err := fastResp.Pack()
+	require.NoError(t, err)
+
+	slowAddr := mockForwarderWithDelay(t, slowBytes, 200*time.Millisecond)
+	fastAddr := mockForwarderWithDelay(t, fastBytes, 0)
+
+	f := NewForwarder([]UpstreamConfig{
+		{Addr: slowAddr.String()},
+		{Addr: fastAddr.String()},
+	})
+
+	resp, err := f.Forward(queryBytes)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(resp, fastBytes))
+}
+
+func TestForwarderHealthReordersStartDelays(t *testing.T) {
+	query := &DNSMessage{Header: DNSHeader{ID: 7, QDCount: 1}, Questions: []DNSQuestion{{Name: "test.com", Type: QTypeA, Class: QClassIN}}}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	resp := &DNSMessage{Header: DNSHeader{ID: 7, ANCount: 1, Flags: FlagResponse}, Answers: []DNSRecord{{Name: "test.com", RData: []byte{3, 3, 3, 3}}}}
+	respBytes, err := resp.Pack()
+	require.NoError(t, err)
+
+	healthy := mockForwarderWithDelay(t, respBytes, 0)
+
+	// An upstream nothing is listening on: Forward should fail fast
+	// against it (connection refused) and mark it unhealthy.
+	deadConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	deadAddr := deadConn.LocalAddr().(*net.UDPAddr)
+	require.NoError(t, deadConn.Close())
+
+	f := NewForwarder([]UpstreamConfig{
+		{Addr: deadAddr.String(), StartDelay: 0},
+		{Addr: healthy.String(), StartDelay: 50 * time.Millisecond},
+	})
+
+	_, err = f.Forward(queryBytes)
+	require.NoError(t, err)
+
+	ranked := f.ranked()
+	require.Equal(t, healthy.String(), ranked[0].Addr)
+	require.Equal(t, time.Duration(0), ranked[0].StartDelay)
+}
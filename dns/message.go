@@ -5,22 +5,45 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
 	"strings"
 )
 
 const (
-	QTypeA uint16 = 1
-	TypeA         = QTypeA
+	QTypeA     uint16 = 1
+	QTypeNS    uint16 = 2
+	QTypeCNAME uint16 = 5
+	QTypeSOA   uint16 = 6
+	QTypePTR   uint16 = 12
+	QTypeMX    uint16 = 15
+	QTypeTXT   uint16 = 16
+	QTypeAAAA  uint16 = 28
+	QTypeSRV   uint16 = 33
+	QTypeOPT   uint16 = 41
+	TypeA             = QTypeA
 
 	QClassIN uint16 = 1
 	ClassIN         = QClassIN
 
 	FlagResponse           uint16 = 1 << 15
+	FlagTruncated          uint16 = 1 << 9
 	FlagRecursionDesired   uint16 = 1 << 8
 	FlagRecursionAvailable uint16 = 1 << 7
 
+	// RCode values occupy the low 4 bits of DNSHeader.Flags.
+	RCodeNoError  uint16 = 0
+	RCodeNXDomain uint16 = 3
+
 	DNSHeaderSize        = 12
 	DefaultUDPBufferSize = 512
+
+	// MaxUDPMessageSize is the largest EDNS(0) UDP payload size this
+	// package will advertise or allocate buffers for.
+	MaxUDPMessageSize = 4096
+
+	// EDNS0 option codes (RFC 6891 / RFC 7871).
+	EDNS0OptionNSID uint16 = 3
+	EDNS0OptionECS  uint16 = 8
 )
 
 type DNSHeader struct {
@@ -60,32 +83,90 @@ func (msg *DNSMessage) Pack() ([]byte, error) {
 
 	binary.Write(&buf, binary.BigEndian, msg.Header)
 
+	compress := newNameCompressor()
 	for _, q := range msg.Questions {
-		buf.Write(encodeDomainName(q.Name))
+		buf.Write(compress.encode(q.Name, buf.Len()))
 		binary.Write(&buf, binary.BigEndian, q.Type)
 		binary.Write(&buf, binary.BigEndian, q.Class)
 	}
 
 	for _, a := range msg.Answers {
-		packRecord(&buf, a)
+		packRecord(&buf, a, compress)
 	}
 	for _, a := range msg.Authority {
-		packRecord(&buf, a)
+		packRecord(&buf, a, compress)
 	}
 	for _, a := range msg.Additional {
-		packRecord(&buf, a)
+		packRecord(&buf, a, compress)
 	}
 
 	return buf.Bytes(), nil
 }
 
-func packRecord(buf *bytes.Buffer, record DNSRecord) {
-	buf.Write(encodeDomainName(record.Name))
+// packRecord writes record's owner name, fixed fields, and RDATA into
+// buf, recomputing RDLENGTH from the RDATA actually written: RDATA
+// containing a domain name is routed through compress (see
+// packRData), so its encoded length can differ from record.RDLength
+// if compression applies.
+func packRecord(buf *bytes.Buffer, record DNSRecord, compress *nameCompressor) {
+	buf.Write(compress.encode(record.Name, buf.Len()))
 	binary.Write(buf, binary.BigEndian, record.Type)
 	binary.Write(buf, binary.BigEndian, record.Class)
 	binary.Write(buf, binary.BigEndian, record.TTL)
-	binary.Write(buf, binary.BigEndian, record.RDLength)
-	buf.Write(record.RData)
+
+	rdataOffset := buf.Len() + 2 // +2 for the RDLENGTH field written below
+	rdata := packRData(record, compress, rdataOffset)
+	binary.Write(buf, binary.BigEndian, uint16(len(rdata)))
+	buf.Write(rdata)
+}
+
+// nameCompressor tracks the offset at which each domain name suffix
+// has already been written into a message being packed, so that a
+// later owner name can reference it with a compression pointer
+// instead of repeating its labels (RFC 1035 section 4.1.4).
+type nameCompressor struct {
+	offsets map[string]int // lowercased suffix -> offset it was first written at
+}
+
+func newNameCompressor() *nameCompressor {
+	return &nameCompressor{offsets: make(map[string]int)}
+}
+
+// encode returns the wire encoding of name as written at offset: a
+// 2-byte pointer to the longest already-seen suffix of name, preceded
+// by any of its labels that haven't been seen yet. Newly written
+// labels are recorded under offset for later names to reference.
+// Offsets beyond the 14 bits a pointer can hold are never recorded or
+// referenced, since RFC 1035 compression pointers can't address them.
+func (c *nameCompressor) encode(name string, offset int) []byte {
+	if name == "" || name == "." {
+		return []byte{0}
+	}
+	// A nil compressor (NewRecord building a record in isolation) or a
+	// negative offset (no real position to point at yet) can't safely
+	// produce a pointer, which is only valid as an offset into a
+	// specific message buffer: fall back to plain, pointer-free labels.
+	if c == nil || offset < 0 {
+		return encodeDomainName(name)
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	var out bytes.Buffer
+	for i := 0; i < len(labels); i++ {
+		suffix := strings.ToLower(strings.Join(labels[i:], "."))
+		if pointer, ok := c.offsets[suffix]; ok {
+			binary.Write(&out, binary.BigEndian, uint16(0xC000|pointer))
+			return out.Bytes()
+		}
+
+		if pos := offset + out.Len(); pos <= 0x3FFF {
+			c.offsets[suffix] = pos
+		}
+		out.WriteByte(byte(len(labels[i])))
+		out.WriteString(labels[i])
+	}
+	out.WriteByte(0)
+	return out.Bytes()
 }
 
 func ParseDNSMessage(data []byte) (*DNSMessage, error) {
@@ -172,16 +253,20 @@ func parseRecord(data []byte, offset int) (DNSRecord, int, error) {
 	record.Type = binary.BigEndian.Uint16(data[offset : offset+2])
 	record.Class = binary.BigEndian.Uint16(data[offset+2 : offset+4])
 	record.TTL = binary.BigEndian.Uint32(data[offset+4 : offset+8])
-	record.RDLength = binary.BigEndian.Uint16(data[offset+8 : offset+10])
+	wireRDLength := int(binary.BigEndian.Uint16(data[offset+8 : offset+10]))
 	offset += 10
 
-	if offset+int(record.RDLength) > len(data) {
+	if offset+wireRDLength > len(data) {
 		return record, offset, errors.New("truncated rdata")
 	}
 
-	record.RData = make([]byte, record.RDLength)
-	copy(record.RData, data[offset:offset+int(record.RDLength)])
-	offset += int(record.RDLength)
+	rdata, err := canonicalizeRDATA(record.Type, data, offset, wireRDLength)
+	if err != nil {
+		return record, offset, fmt.Errorf("parsing rdata: %w", err)
+	}
+	record.RData = rdata
+	record.RDLength = uint16(len(rdata))
+	offset += wireRDLength
 
 	return record, offset, nil
 }
@@ -241,7 +326,7 @@ func decodeDomainName(data []byte, offset int) (string, int, error) {
 			}
 			name.WriteString(suffixName)
 
-			return name.String(), originalOffset + 2, nil
+			return name.String(), offset + 2, nil
 		}
 
 		offset++
@@ -263,3 +348,221 @@ func decodeDomainName(data []byte, offset int) (string, int, error) {
 		offset += length
 	}
 }
+
+// adjustWireTTLs returns a copy of wire with adjust applied to every
+// answer, authority, and additional record's TTL field, in place. It
+// walks the wire format directly rather than parsing the message and
+// calling Pack again, since re-encoding could shift a compression
+// pointer embedded in some record's RDATA out from under itself;
+// adjust never needs to touch RDATA, so this walk only needs to skip
+// over it by its declared RDLENGTH.
+func adjustWireTTLs(wire []byte, adjust func(ttl uint32) uint32) ([]byte, error) {
+	if len(wire) < DNSHeaderSize {
+		return nil, errors.New("message too short")
+	}
+	out := append([]byte(nil), wire...)
+
+	qdCount := binary.BigEndian.Uint16(out[4:6])
+	anCount := binary.BigEndian.Uint16(out[6:8])
+	nsCount := binary.BigEndian.Uint16(out[8:10])
+	arCount := binary.BigEndian.Uint16(out[10:12])
+
+	offset := DNSHeaderSize
+	for i := uint16(0); i < qdCount; i++ {
+		_, next, err := decodeDomainName(out, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(out) {
+			return nil, errors.New("truncated question section")
+		}
+		offset = next + 4
+	}
+
+	for _, count := range [3]uint16{anCount, nsCount, arCount} {
+		for i := uint16(0); i < count; i++ {
+			next, err := adjustRecordTTL(out, offset, adjust)
+			if err != nil {
+				return nil, err
+			}
+			offset = next
+		}
+	}
+
+	return out, nil
+}
+
+// adjustRecordTTL rewrites the TTL field of the single record starting
+// at offset in wire (an OPT pseudo-record's TTL carries EDNS0 flags,
+// not a real TTL, and is left alone), returning the offset of the next
+// record.
+func adjustRecordTTL(wire []byte, offset int, adjust func(ttl uint32) uint32) (int, error) {
+	_, next, err := decodeDomainName(wire, offset)
+	if err != nil {
+		return 0, err
+	}
+	if next+10 > len(wire) {
+		return 0, errors.New("truncated record header")
+	}
+
+	recType := binary.BigEndian.Uint16(wire[next : next+2])
+	ttlOffset := next + 4
+	rdlength := int(binary.BigEndian.Uint16(wire[next+8 : next+10]))
+	next += 10
+
+	if recType != QTypeOPT {
+		ttl := binary.BigEndian.Uint32(wire[ttlOffset : ttlOffset+4])
+		binary.BigEndian.PutUint32(wire[ttlOffset:ttlOffset+4], adjust(ttl))
+	}
+
+	if next+rdlength > len(wire) {
+		return 0, errors.New("truncated rdata")
+	}
+	return next + rdlength, nil
+}
+
+// EDNS0Option is a single option TLV carried in an OPT record's RDATA
+// (RFC 6891 section 6.1.2).
+type EDNS0Option struct {
+	Code uint16
+	Data []byte
+}
+
+// EDNS0 is the decoded form of a query or response's OPT pseudo-RR:
+// the requestor's UDP payload size plus the extended RCODE, version,
+// and DO (DNSSEC OK) bit that RFC 6891 packs into the TTL field.
+type EDNS0 struct {
+	UDPSize  uint16
+	ExtRCODE uint8
+	Version  uint8
+	DO       bool
+	Options  []EDNS0Option
+}
+
+// SetEDNS0 attaches (or replaces) an OPT record in msg's Additional
+// section advertising udpSize as the UDP payload size and dnssecOK as
+// the DO bit.
+func (msg *DNSMessage) SetEDNS0(udpSize uint16, dnssecOK bool) {
+	edns := &EDNS0{UDPSize: udpSize, DO: dnssecOK}
+	msg.Additional = removeOPT(msg.Additional)
+	msg.Additional = append(msg.Additional, edns.record())
+	msg.Header.ARCount = uint16(len(msg.Additional))
+}
+
+// EDNS0 returns the decoded OPT record from msg's Additional section,
+// or nil if msg carries no EDNS(0) pseudo-RR.
+func (msg *DNSMessage) EDNS0() *EDNS0 {
+	for _, rec := range msg.Additional {
+		if rec.Type == QTypeOPT {
+			return decodeEDNS0(rec)
+		}
+	}
+	return nil
+}
+
+func removeOPT(records []DNSRecord) []DNSRecord {
+	out := make([]DNSRecord, 0, len(records))
+	for _, rec := range records {
+		if rec.Type != QTypeOPT {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// record packs e into the wire-level OPT pseudo-RR: owner name ".",
+// the UDP payload size in the CLASS field, and ExtRCODE/Version/DO
+// packed into the TTL field, per RFC 6891 section 6.1.3.
+func (e *EDNS0) record() DNSRecord {
+	ttl := uint32(e.ExtRCODE)<<24 | uint32(e.Version)<<16
+	if e.DO {
+		ttl |= 1 << 15
+	}
+
+	rdata := encodeEDNS0Options(e.Options)
+	return DNSRecord{
+		Name:     ".",
+		Type:     QTypeOPT,
+		Class:    e.UDPSize,
+		TTL:      ttl,
+		RDLength: uint16(len(rdata)),
+		RData:    rdata,
+	}
+}
+
+func decodeEDNS0(rec DNSRecord) *EDNS0 {
+	return &EDNS0{
+		UDPSize:  rec.Class,
+		ExtRCODE: uint8(rec.TTL >> 24),
+		Version:  uint8(rec.TTL >> 16),
+		DO:       rec.TTL&(1<<15) != 0,
+		Options:  decodeEDNS0Options(rec.RData),
+	}
+}
+
+func encodeEDNS0Options(opts []EDNS0Option) []byte {
+	var buf bytes.Buffer
+	for _, opt := range opts {
+		binary.Write(&buf, binary.BigEndian, opt.Code)
+		binary.Write(&buf, binary.BigEndian, uint16(len(opt.Data)))
+		buf.Write(opt.Data)
+	}
+	return buf.Bytes()
+}
+
+func decodeEDNS0Options(data []byte) []EDNS0Option {
+	var opts []EDNS0Option
+	offset := 0
+	for offset+4 <= len(data) {
+		code := binary.BigEndian.Uint16(data[offset : offset+2])
+		length := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		offset += 4
+		if offset+length > len(data) {
+			break
+		}
+		opts = append(opts, EDNS0Option{Code: code, Data: append([]byte(nil), data[offset:offset+length]...)})
+		offset += length
+	}
+	return opts
+}
+
+// ECS is the decoded payload of an EDNS Client Subnet option
+// (RFC 7871): FAMILY 1 is IPv4, FAMILY 2 is IPv6.
+type ECS struct {
+	Family          uint16
+	SourcePrefixLen uint8
+	ScopePrefixLen  uint8
+	Address         net.IP
+}
+
+// Option encodes e as an EDNS0Option with code EDNS0OptionECS.
+func (e ECS) Option() EDNS0Option {
+	addr := e.Address.To4()
+	if e.Family == 2 {
+		addr = e.Address.To16()
+	}
+	addrLen := (int(e.SourcePrefixLen) + 7) / 8
+	if addrLen < len(addr) {
+		addr = addr[:addrLen]
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, e.Family)
+	buf.WriteByte(e.SourcePrefixLen)
+	buf.WriteByte(e.ScopePrefixLen)
+	buf.Write(addr)
+	return EDNS0Option{Code: EDNS0OptionECS, Data: buf.Bytes()}
+}
+
+// DecodeECS decodes opt as an EDNS Client Subnet option.
+func DecodeECS(opt EDNS0Option) (ECS, bool) {
+	if opt.Code != EDNS0OptionECS || len(opt.Data) < 4 {
+		return ECS{}, false
+	}
+	return ECS{
+		Family:          binary.BigEndian.Uint16(opt.Data[0:2]),
+		SourcePrefixLen: opt.Data[2],
+		ScopePrefixLen:  opt.Data[3],
+		Address:         append(net.IP(nil), opt.Data[4:]...),
+	}, true
+}
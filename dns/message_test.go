@@ -85,3 +85,40 @@ func TestRoundTripAResponse(t *testing.T) {
 	require.Equal(t, originalMsg.Answers[0].Name, parsedMsg.Answers[0].Name)
 	require.True(t, bytes.Equal(originalMsg.Answers[0].RData, parsedMsg.Answers[0].RData))
 }
+
+// TestEDNS0RoundTrip tests that SetEDNS0 writes an OPT record that
+// EDNS0 can decode back into the original payload size and DO bit.
+func TestEDNS0RoundTrip(t *testing.T) {
+	msg := &DNSMessage{
+		Header:    DNSHeader{ID: 1, Flags: FlagRecursionDesired, QDCount: 1},
+		Questions: []DNSQuestion{{Name: "example.com", Type: QTypeA, Class: QClassIN}},
+	}
+	msg.SetEDNS0(4096, true)
+
+	packed, err := msg.Pack()
+	require.NoError(t, err)
+
+	parsed, err := ParseDNSMessage(packed)
+	require.NoError(t, err)
+
+	opt := parsed.EDNS0()
+	require.NotNil(t, opt)
+	require.Equal(t, uint16(4096), opt.UDPSize)
+	require.True(t, opt.DO)
+}
+
+func TestEDNS0AbsentWithoutOPT(t *testing.T) {
+	msg := &DNSMessage{Header: DNSHeader{ID: 1, QDCount: 1}, Questions: []DNSQuestion{{Name: "example.com", Type: QTypeA, Class: QClassIN}}}
+	require.Nil(t, msg.EDNS0())
+}
+
+func TestECSOptionRoundTrip(t *testing.T) {
+	ecs := ECS{Family: 1, SourcePrefixLen: 24, ScopePrefixLen: 0, Address: net.ParseIP("203.0.113.0")}
+	opt := ecs.Option()
+
+	decoded, ok := DecodeECS(opt)
+	require.True(t, ok)
+	require.Equal(t, ecs.Family, decoded.Family)
+	require.Equal(t, ecs.SourcePrefixLen, decoded.SourcePrefixLen)
+	require.True(t, bytes.Equal(decoded.Address, []byte{203, 0, 113}))
+}
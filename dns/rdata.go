@@ -0,0 +1,377 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// RData is a typed resource-record payload: something that knows its
+// own RR type and can serialize itself into wire-format RDATA.
+//
+// Domain names embedded in RDATA (CNAME/MX/NS/SOA/PTR/SRV) are written
+// through compress at offset, the position the RDATA occupies in the
+// message being packed, so they can share compression pointers with
+// the rest of the message the same way owner names do (see
+// nameCompressor). NewRecord, which serializes a record in isolation
+// with no such position to offer, passes a nil compressor and a
+// negative offset, which fall back to plain, pointer-free labels.
+type RData interface {
+	Type() uint16
+	pack(compress *nameCompressor, offset int) []byte
+}
+
+// NewRecord builds a class-IN DNSRecord carrying rd, wire-encoding its
+// RDATA immediately.
+func NewRecord(name string, ttl uint32, rd RData) DNSRecord {
+	rdata := rd.pack(nil, -1)
+	return DNSRecord{
+		Name:     name,
+		Type:     rd.Type(),
+		Class:    QClassIN,
+		TTL:      ttl,
+		RDLength: uint16(len(rdata)),
+		RData:    rdata,
+	}
+}
+
+// packRData serializes record's RDATA for inclusion in a packed
+// message at rdataOffset (the absolute offset the RDATA bytes will
+// occupy), routing any domain name it carries through compress so it
+// can be written as a pointer into the rest of the message. Record
+// types this package doesn't decode are re-emitted verbatim; parseRecord
+// canonicalizes RDATA on the way in (see canonicalizeRDATA), so a
+// decodable record's RData is always plain, pointer-free wire data by
+// the time it reaches here.
+func packRData(record DNSRecord, compress *nameCompressor, rdataOffset int) []byte {
+	rd, err := record.Decode()
+	if err != nil {
+		return record.RData
+	}
+	return rd.pack(compress, rdataOffset)
+}
+
+// canonicalizeRDATA resolves any compression pointer a record's RDATA
+// might embed — real nameservers emit these for CNAME chains, NS sets,
+// MX, SOA, PTR, and SRV records — while data still gives access to the
+// whole message the record was parsed from, and rewrites the name(s)
+// in place without pointers. Doing this at parse time, rather than
+// leaving a pointer sitting in RData, means a later Pack of the same
+// record never holds an offset that was only ever valid relative to
+// the exact buffer it was parsed from.
+func canonicalizeRDATA(recType uint16, data []byte, rdataOffset, rdlength int) ([]byte, error) {
+	end := rdataOffset + rdlength
+
+	switch recType {
+	case QTypeCNAME, QTypeNS, QTypePTR:
+		name, next, err := decodeDomainName(data, rdataOffset)
+		if err != nil {
+			return nil, err
+		}
+		if next != end {
+			return nil, fmt.Errorf("record RDATA has trailing bytes after domain name")
+		}
+		return encodeDomainName(name), nil
+
+	case QTypeMX:
+		if rdataOffset+2 > end {
+			return nil, fmt.Errorf("MX record: RDATA too short")
+		}
+		name, next, err := decodeDomainName(data, rdataOffset+2)
+		if err != nil {
+			return nil, err
+		}
+		if next != end {
+			return nil, fmt.Errorf("MX record: trailing bytes after exchange name")
+		}
+		var buf bytes.Buffer
+		buf.Write(data[rdataOffset : rdataOffset+2])
+		buf.Write(encodeDomainName(name))
+		return buf.Bytes(), nil
+
+	case QTypeSRV:
+		if rdataOffset+6 > end {
+			return nil, fmt.Errorf("SRV record: RDATA too short")
+		}
+		name, next, err := decodeDomainName(data, rdataOffset+6)
+		if err != nil {
+			return nil, err
+		}
+		if next != end {
+			return nil, fmt.Errorf("SRV record: trailing bytes after target name")
+		}
+		var buf bytes.Buffer
+		buf.Write(data[rdataOffset : rdataOffset+6])
+		buf.Write(encodeDomainName(name))
+		return buf.Bytes(), nil
+
+	case QTypeSOA:
+		mname, next, err := decodeDomainName(data, rdataOffset)
+		if err != nil {
+			return nil, err
+		}
+		var rname string
+		rname, next, err = decodeDomainName(data, next)
+		if err != nil {
+			return nil, err
+		}
+		if next+20 != end {
+			return nil, fmt.Errorf("SOA record: RDATA too short for fixed fields")
+		}
+		var buf bytes.Buffer
+		buf.Write(encodeDomainName(mname))
+		buf.Write(encodeDomainName(rname))
+		buf.Write(data[next:end])
+		return buf.Bytes(), nil
+
+	default:
+		return append([]byte(nil), data[rdataOffset:end]...), nil
+	}
+}
+
+// Decode parses rec's RDATA into its typed representation, based on
+// rec.Type. rec.RData is a standalone slice with no access to the
+// rest of the message it came from, so a domain name inside it that
+// uses a compression pointer can't be resolved and is reported as an
+// error rather than silently mis-parsed.
+func (rec *DNSRecord) Decode() (RData, error) {
+	switch rec.Type {
+	case QTypeAAAA:
+		if len(rec.RData) != 16 {
+			return nil, fmt.Errorf("AAAA record: want 16 bytes of RDATA, got %d", len(rec.RData))
+		}
+		return AAAA{IP: append(net.IP(nil), rec.RData...)}, nil
+
+	case QTypeCNAME:
+		target, err := decodeUncompressedName(rec.RData)
+		if err != nil {
+			return nil, fmt.Errorf("CNAME record: %w", err)
+		}
+		return CNAME{Target: target}, nil
+
+	case QTypeNS:
+		ns, err := decodeUncompressedName(rec.RData)
+		if err != nil {
+			return nil, fmt.Errorf("NS record: %w", err)
+		}
+		return NS{NS: ns}, nil
+
+	case QTypePTR:
+		ptr, err := decodeUncompressedName(rec.RData)
+		if err != nil {
+			return nil, fmt.Errorf("PTR record: %w", err)
+		}
+		return PTR{Ptr: ptr}, nil
+
+	case QTypeMX:
+		if len(rec.RData) < 3 {
+			return nil, fmt.Errorf("MX record: RDATA too short")
+		}
+		exchange, err := decodeUncompressedName(rec.RData[2:])
+		if err != nil {
+			return nil, fmt.Errorf("MX record: %w", err)
+		}
+		return MX{Preference: binary.BigEndian.Uint16(rec.RData[0:2]), Exchange: exchange}, nil
+
+	case QTypeSRV:
+		if len(rec.RData) < 7 {
+			return nil, fmt.Errorf("SRV record: RDATA too short")
+		}
+		target, err := decodeUncompressedName(rec.RData[6:])
+		if err != nil {
+			return nil, fmt.Errorf("SRV record: %w", err)
+		}
+		return SRV{
+			Priority: binary.BigEndian.Uint16(rec.RData[0:2]),
+			Weight:   binary.BigEndian.Uint16(rec.RData[2:4]),
+			Port:     binary.BigEndian.Uint16(rec.RData[4:6]),
+			Target:   target,
+		}, nil
+
+	case QTypeTXT:
+		return TXT{Strings: decodeCharacterStrings(rec.RData)}, nil
+
+	case QTypeSOA:
+		mname, offset, err := decodeUncompressedNameAt(rec.RData, 0)
+		if err != nil {
+			return nil, fmt.Errorf("SOA record: parsing MNAME: %w", err)
+		}
+		rname, offset, err := decodeUncompressedNameAt(rec.RData, offset)
+		if err != nil {
+			return nil, fmt.Errorf("SOA record: parsing RNAME: %w", err)
+		}
+		if offset+20 > len(rec.RData) {
+			return nil, fmt.Errorf("SOA record: RDATA too short for fixed fields")
+		}
+		return SOA{
+			MName:   mname,
+			RName:   rname,
+			Serial:  binary.BigEndian.Uint32(rec.RData[offset : offset+4]),
+			Refresh: binary.BigEndian.Uint32(rec.RData[offset+4 : offset+8]),
+			Retry:   binary.BigEndian.Uint32(rec.RData[offset+8 : offset+12]),
+			Expire:  binary.BigEndian.Uint32(rec.RData[offset+12 : offset+16]),
+			Minimum: binary.BigEndian.Uint32(rec.RData[offset+16 : offset+20]),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("Decode: unsupported record type %d", rec.Type)
+	}
+}
+
+// decodeUncompressedName decodes a domain name occupying the entirety
+// of data, rejecting any compression pointer: data is an isolated
+// RDATA slice with no access to the rest of the message, so such a
+// pointer can't be resolved.
+func decodeUncompressedName(data []byte) (string, error) {
+	name, _, err := decodeUncompressedNameAt(data, 0)
+	return name, err
+}
+
+// decodeUncompressedNameAt is decodeUncompressedName for the name
+// starting at offset in data, also returning the offset just past it.
+func decodeUncompressedNameAt(data []byte, offset int) (string, int, error) {
+	for i := offset; i < len(data) && data[i] != 0; i += int(data[i]) + 1 {
+		if data[i]&0xC0 == 0xC0 {
+			return "", offset, fmt.Errorf("compressed name in standalone RDATA can't be resolved")
+		}
+	}
+	return decodeDomainName(data, offset)
+}
+
+// decodeCharacterStrings splits data into a sequence of
+// length-prefixed character-strings (RFC 1035 section 3.3), the
+// encoding TXT RDATA uses.
+func decodeCharacterStrings(data []byte) []string {
+	var out []string
+	for offset := 0; offset < len(data); {
+		length := int(data[offset])
+		offset++
+		if offset+length > len(data) {
+			break
+		}
+		out = append(out, string(data[offset:offset+length]))
+		offset += length
+	}
+	return out
+}
+
+// AAAA is an IPv6 host address record.
+type AAAA struct {
+	IP net.IP
+}
+
+func (AAAA) Type() uint16 { return QTypeAAAA }
+
+func (r AAAA) pack(compress *nameCompressor, offset int) []byte {
+	return append([]byte(nil), r.IP.To16()...)
+}
+
+// CNAME is a canonical name record.
+type CNAME struct {
+	Target string
+}
+
+func (CNAME) Type() uint16 { return QTypeCNAME }
+
+func (r CNAME) pack(compress *nameCompressor, offset int) []byte {
+	return compress.encode(r.Target, offset)
+}
+
+// NS is an authoritative name server record.
+type NS struct {
+	NS string
+}
+
+func (NS) Type() uint16 { return QTypeNS }
+
+func (r NS) pack(compress *nameCompressor, offset int) []byte {
+	return compress.encode(r.NS, offset)
+}
+
+// PTR is a domain name pointer record, used for reverse lookups.
+type PTR struct {
+	Ptr string
+}
+
+func (PTR) Type() uint16 { return QTypePTR }
+
+func (r PTR) pack(compress *nameCompressor, offset int) []byte {
+	return compress.encode(r.Ptr, offset)
+}
+
+// MX is a mail exchange record.
+type MX struct {
+	Preference uint16
+	Exchange   string
+}
+
+func (MX) Type() uint16 { return QTypeMX }
+
+func (r MX) pack(compress *nameCompressor, offset int) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, r.Preference)
+	buf.Write(compress.encode(r.Exchange, offset+buf.Len()))
+	return buf.Bytes()
+}
+
+// SRV is a service location record (RFC 2782).
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+func (SRV) Type() uint16 { return QTypeSRV }
+
+func (r SRV) pack(compress *nameCompressor, offset int) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, r.Priority)
+	binary.Write(&buf, binary.BigEndian, r.Weight)
+	binary.Write(&buf, binary.BigEndian, r.Port)
+	buf.Write(compress.encode(r.Target, offset+buf.Len()))
+	return buf.Bytes()
+}
+
+// TXT is one or more free-form character-strings (RFC 1035 section
+// 3.3.14).
+type TXT struct {
+	Strings []string
+}
+
+func (TXT) Type() uint16 { return QTypeTXT }
+
+func (r TXT) pack(compress *nameCompressor, offset int) []byte {
+	var buf bytes.Buffer
+	for _, s := range r.Strings {
+		buf.WriteByte(byte(len(s)))
+		buf.WriteString(s)
+	}
+	return buf.Bytes()
+}
+
+// SOA is a start-of-authority record.
+type SOA struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+func (SOA) Type() uint16 { return QTypeSOA }
+
+func (r SOA) pack(compress *nameCompressor, offset int) []byte {
+	var buf bytes.Buffer
+	buf.Write(compress.encode(r.MName, offset))
+	buf.Write(compress.encode(r.RName, offset+buf.Len()))
+	binary.Write(&buf, binary.BigEndian, r.Serial)
+	binary.Write(&buf, binary.BigEndian, r.Refresh)
+	binary.Write(&buf, binary.BigEndian, r.Retry)
+	binary.Write(&buf, binary.BigEndian, r.Expire)
+	binary.Write(&buf, binary.BigEndian, r.Minimum)
+	return buf.Bytes()
+}
@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRoundTripsThroughDecode(t *testing.T) {
+	cases := []RData{
+		AAAA{IP: net.ParseIP("2001:db8::1")},
+		CNAME{Target: "canonical.example.com"},
+		NS{NS: "ns1.example.com"},
+		PTR{Ptr: "host.example.com"},
+		MX{Preference: 10, Exchange: "mail.example.com"},
+		SRV{Priority: 1, Weight: 2, Port: 5060, Target: "sip.example.com"},
+		TXT{Strings: []string{"v=spf1", "include:example.com"}},
+		SOA{MName: "ns1.example.com", RName: "admin.example.com", Serial: 1, Refresh: 2, Retry: 3, Expire: 4, Minimum: 5},
+	}
+
+	for _, rd := range cases {
+		rec := NewRecord("example.com", 300, rd)
+		require.Equal(t, rd.Type(), rec.Type)
+
+		decoded, err := rec.Decode()
+		require.NoError(t, err)
+		require.Equal(t, rd, decoded)
+	}
+}
+
+func TestRecordRoundTripsThroughPack(t *testing.T) {
+	msg := &DNSMessage{
+		Header:    DNSHeader{ID: 1, Flags: FlagResponse, QDCount: 1, ANCount: 1},
+		Questions: []DNSQuestion{{Name: "example.com", Type: QTypeMX, Class: QClassIN}},
+		Answers:   []DNSRecord{NewRecord("example.com", 300, MX{Preference: 10, Exchange: "mail.example.com"})},
+	}
+
+	packed, err := msg.Pack()
+	require.NoError(t, err)
+
+	parsed, err := ParseDNSMessage(packed)
+	require.NoError(t, err)
+	require.Len(t, parsed.Answers, 1)
+
+	decoded, err := parsed.Answers[0].Decode()
+	require.NoError(t, err)
+	require.Equal(t, MX{Preference: 10, Exchange: "mail.example.com"}, decoded)
+}
+
+func TestDecodeRejectsUnsupportedType(t *testing.T) {
+	rec := DNSRecord{Name: "example.com", Type: QTypeA, RData: []byte{1, 2, 3, 4}}
+	_, err := rec.Decode()
+	require.Error(t, err)
+}
+
+func TestNameCompressorReusesRepeatedOwnerName(t *testing.T) {
+	msg := &DNSMessage{
+		Header:    DNSHeader{ID: 1, Flags: FlagResponse, QDCount: 1, ANCount: 2},
+		Questions: []DNSQuestion{{Name: "example.com", Type: QTypeA, Class: QClassIN}},
+		Answers: []DNSRecord{
+			{Name: "example.com", Type: QTypeA, Class: QClassIN, TTL: 300, RDLength: 4, RData: []byte{1, 1, 1, 1}},
+			{Name: "example.com", Type: QTypeA, Class: QClassIN, TTL: 300, RDLength: 4, RData: []byte{2, 2, 2, 2}},
+		},
+	}
+
+	packed, err := msg.Pack()
+	require.NoError(t, err)
+
+	// header(12) + question name(13)+type+class(4) + each answer's
+	// 2-byte pointer to the question's name (it's already been seen)
+	// in place of its name, plus fixed fields(10)+rdata(4).
+	require.Equal(t, 12+17+2*16, len(packed))
+
+	parsed, err := ParseDNSMessage(packed)
+	require.NoError(t, err)
+	require.Len(t, parsed.Answers, 2)
+	require.Equal(t, "example.com", parsed.Answers[0].Name)
+	require.Equal(t, "example.com", parsed.Answers[1].Name)
+}
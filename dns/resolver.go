@@ -0,0 +1,280 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Resolver answers a single question from local data, without
+// contacting any upstream server. The returned bool reports whether
+// question is authoritatively known to this resolver: true with zero
+// records means the name is known but blocked, and should be answered
+// with NXDOMAIN rather than forwarded upstream.
+type Resolver interface {
+	Lookup(question DNSQuestion) ([]DNSRecord, bool)
+}
+
+// HostsFile is a Resolver backed by an /etc/hosts-style file. Each
+// non-comment line is "<ip> <name> [name...]"; a name may start with
+// "*." to match any subdomain, e.g. "192.168.1.1 *.lan" answers
+// nas.lan, printer.lan, and so on.
+type HostsFile struct {
+	exact    map[string][]net.IP
+	wildcard map[string][]net.IP // suffix (without "*.") -> ips
+}
+
+// LoadHostsFile reads and parses the hosts file at path.
+func LoadHostsFile(path string) (*HostsFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening hosts file: %w", err)
+	}
+	defer f.Close()
+
+	h := &HostsFile{
+		exact:    make(map[string][]net.IP),
+		wildcard: make(map[string][]net.IP),
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+
+		for _, name := range fields[1:] {
+			h.add(strings.ToLower(name), ip)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading hosts file: %w", err)
+	}
+	return h, nil
+}
+
+func (h *HostsFile) add(name string, ip net.IP) {
+	name = strings.TrimSuffix(name, ".")
+	if suffix, ok := strings.CutPrefix(name, "*."); ok {
+		h.wildcard[suffix] = append(h.wildcard[suffix], ip)
+		return
+	}
+	h.exact[name] = append(h.exact[name], ip)
+}
+
+// Lookup implements Resolver.
+func (h *HostsFile) Lookup(question DNSQuestion) ([]DNSRecord, bool) {
+	if question.Class != QClassIN || (question.Type != QTypeA && question.Type != QTypeAAAA) {
+		return nil, false
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name, "."))
+	ips, ok := h.exact[name]
+	if !ok {
+		ips, ok = h.lookupWildcard(name)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var answers []DNSRecord
+	for _, ip := range ips {
+		if rec, ok := addressRecord(question.Name, question.Type, ip); ok {
+			answers = append(answers, rec)
+		}
+	}
+	// A name listed only under the other address family isn't blocked:
+	// report no match so the query is forwarded rather than NXDOMAINed.
+	return answers, len(answers) > 0
+}
+
+func (h *HostsFile) lookupWildcard(name string) ([]net.IP, bool) {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '.' {
+			if ips, ok := h.wildcard[name[i+1:]]; ok {
+				return ips, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// addressRecord builds an A or AAAA record for ip, or reports false if
+// ip's address family doesn't match qtype.
+func addressRecord(name string, qtype uint16, ip net.IP) (DNSRecord, bool) {
+	switch qtype {
+	case QTypeA:
+		v4 := ip.To4()
+		if v4 == nil {
+			return DNSRecord{}, false
+		}
+		return DNSRecord{Name: name, Type: QTypeA, Class: QClassIN, TTL: 300, RDLength: 4, RData: v4}, true
+	case QTypeAAAA:
+		if ip.To4() != nil {
+			return DNSRecord{}, false
+		}
+		v6 := ip.To16()
+		if v6 == nil {
+			return DNSRecord{}, false
+		}
+		return DNSRecord{Name: name, Type: QTypeAAAA, Class: QClassIN, TTL: 300, RDLength: 16, RData: v6}, true
+	}
+	return DNSRecord{}, false
+}
+
+// ZoneStore is a Resolver over user-configured authoritative records,
+// including reverse-lookup zones (in-addr.arpa / ip6.arpa) and a
+// blocklist that synthesizes NXDOMAIN for matching names.
+type ZoneStore struct {
+	records map[string]map[uint16][]DNSRecord
+	blocked map[string]bool
+}
+
+// NewZoneStore returns an empty ZoneStore.
+func NewZoneStore() *ZoneStore {
+	return &ZoneStore{
+		records: make(map[string]map[uint16][]DNSRecord),
+		blocked: make(map[string]bool),
+	}
+}
+
+func zoneKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func (z *ZoneStore) add(name string, rec DNSRecord) {
+	key := zoneKey(name)
+	byType, ok := z.records[key]
+	if !ok {
+		byType = make(map[uint16][]DNSRecord)
+		z.records[key] = byType
+	}
+	byType[rec.Type] = append(byType[rec.Type], rec)
+}
+
+// AddA adds an A record for name.
+func (z *ZoneStore) AddA(name string, ttl uint32, ip net.IP) {
+	v4 := ip.To4()
+	if v4 == nil {
+		return
+	}
+	z.add(name, DNSRecord{Name: name, Type: QTypeA, Class: QClassIN, TTL: ttl, RDLength: 4, RData: v4})
+}
+
+// AddAAAA adds an AAAA record for name.
+func (z *ZoneStore) AddAAAA(name string, ttl uint32, ip net.IP) {
+	if ip.To4() != nil {
+		return
+	}
+	v6 := ip.To16()
+	if v6 == nil {
+		return
+	}
+	z.add(name, DNSRecord{Name: name, Type: QTypeAAAA, Class: QClassIN, TTL: ttl, RDLength: 16, RData: v6})
+}
+
+// AddCNAME adds a CNAME record pointing name at target.
+func (z *ZoneStore) AddCNAME(name, target string, ttl uint32) {
+	z.add(name, NewRecord(name, ttl, CNAME{Target: target}))
+}
+
+// AddTXT adds a TXT record made up of one or more character-strings.
+func (z *ZoneStore) AddTXT(name string, ttl uint32, strs ...string) {
+	z.add(name, NewRecord(name, ttl, TXT{Strings: strs}))
+}
+
+// AddPTR adds a PTR record for the reverse-lookup owner name (e.g.
+// "1.2.3.4.in-addr.arpa") pointing at target.
+func (z *ZoneStore) AddPTR(name, target string, ttl uint32) {
+	z.add(name, NewRecord(name, ttl, PTR{Ptr: target}))
+}
+
+// AddNS adds an NS record delegating name to ns.
+func (z *ZoneStore) AddNS(name, ns string, ttl uint32) {
+	z.add(name, NewRecord(name, ttl, NS{NS: ns}))
+}
+
+// AddMX adds an MX record for name.
+func (z *ZoneStore) AddMX(name string, preference uint16, exchange string, ttl uint32) {
+	z.add(name, NewRecord(name, ttl, MX{Preference: preference, Exchange: exchange}))
+}
+
+// AddSRV adds an SRV record (RFC 2782) for name.
+func (z *ZoneStore) AddSRV(name string, priority, weight, port uint16, target string, ttl uint32) {
+	z.add(name, NewRecord(name, ttl, SRV{Priority: priority, Weight: weight, Port: port, Target: target}))
+}
+
+// AddSOA adds an SOA record for name.
+func (z *ZoneStore) AddSOA(name string, soa SOA, ttl uint32) {
+	z.add(name, NewRecord(name, ttl, soa))
+}
+
+// AddPTRForIP is a convenience wrapper around AddPTR that derives the
+// in-addr.arpa/ip6.arpa owner name from ip.
+func (z *ZoneStore) AddPTRForIP(ip net.IP, target string, ttl uint32) {
+	name, err := reverseLookupName(ip)
+	if err != nil {
+		return
+	}
+	z.AddPTR(name, target, ttl)
+}
+
+// Block marks name as blocked: any query for it synthesizes NXDOMAIN
+// instead of being forwarded upstream.
+func (z *ZoneStore) Block(name string) {
+	z.blocked[zoneKey(name)] = true
+}
+
+// Lookup implements Resolver.
+func (z *ZoneStore) Lookup(question DNSQuestion) ([]DNSRecord, bool) {
+	if question.Class != QClassIN {
+		return nil, false
+	}
+
+	key := zoneKey(question.Name)
+	if z.blocked[key] {
+		return nil, true
+	}
+
+	byType, ok := z.records[key]
+	if !ok {
+		return nil, false
+	}
+	answers, ok := byType[question.Type]
+	if !ok {
+		return nil, false
+	}
+	return answers, true
+}
+
+// reverseLookupName returns the in-addr.arpa (IPv4) or ip6.arpa (IPv6)
+// owner name for ip.
+func reverseLookupName(ip net.IP) (string, error) {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0]), nil
+	}
+
+	v6 := ip.To16()
+	if v6 == nil {
+		return "", fmt.Errorf("invalid IP address: %v", ip)
+	}
+
+	labels := make([]string, 0, len(v6)*2)
+	for i := len(v6) - 1; i >= 0; i-- {
+		labels = append(labels, fmt.Sprintf("%x", v6[i]&0x0f), fmt.Sprintf("%x", v6[i]>>4))
+	}
+	return strings.Join(labels, ".") + ".ip6.arpa", nil
+}
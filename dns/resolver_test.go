@@ -0,0 +1,58 @@
+package dns
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostsFileLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	contents := "192.168.1.10 nas.lan\n192.168.1.1 *.lan\n# a comment\n"
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+
+	h, err := LoadHostsFile(path)
+	require.NoError(t, err)
+
+	answers, matched := h.Lookup(DNSQuestion{Name: "nas.lan", Type: QTypeA, Class: QClassIN})
+	require.True(t, matched)
+	require.Len(t, answers, 1)
+	require.True(t, net.IP(answers[0].RData).Equal(net.ParseIP("192.168.1.10")))
+
+	answers, matched = h.Lookup(DNSQuestion{Name: "printer.lan", Type: QTypeA, Class: QClassIN})
+	require.True(t, matched)
+	require.Len(t, answers, 1)
+	require.True(t, net.IP(answers[0].RData).Equal(net.ParseIP("192.168.1.1")))
+
+	_, matched = h.Lookup(DNSQuestion{Name: "example.com", Type: QTypeA, Class: QClassIN})
+	require.False(t, matched)
+}
+
+func TestZoneStoreBlocklist(t *testing.T) {
+	z := NewZoneStore()
+	z.AddA("router.home.arpa", 300, net.ParseIP("10.0.0.1"))
+	z.Block("ads.example.com")
+
+	answers, matched := z.Lookup(DNSQuestion{Name: "router.home.arpa", Type: QTypeA, Class: QClassIN})
+	require.True(t, matched)
+	require.Len(t, answers, 1)
+
+	answers, matched = z.Lookup(DNSQuestion{Name: "ads.example.com", Type: QTypeA, Class: QClassIN})
+	require.True(t, matched)
+	require.Empty(t, answers)
+
+	_, matched = z.Lookup(DNSQuestion{Name: "unknown.example.com", Type: QTypeA, Class: QClassIN})
+	require.False(t, matched)
+}
+
+func TestZoneStorePTRForIP(t *testing.T) {
+	z := NewZoneStore()
+	z.AddPTRForIP(net.ParseIP("192.168.1.10"), "nas.lan", 300)
+
+	answers, matched := z.Lookup(DNSQuestion{Name: "10.1.168.192.in-addr.arpa", Type: QTypePTR, Class: QClassIN})
+	require.True(t, matched)
+	require.Len(t, answers, 1)
+}
@@ -9,24 +9,62 @@ import (
 )
 
 type DNSServer struct {
-	addr          string
-	forwarderAddr string
-	conn          *net.UDPConn
-	forwarderConn *net.UDPConn
-	running       bool
-	mu            sync.Mutex
-	wg            sync.WaitGroup
+	addr        string
+	conn        *net.UDPConn
+	tcpListener *net.TCPListener
+	forwarder   *Forwarder
+	running     bool
+	mu          sync.Mutex
+	wg          sync.WaitGroup
+
+	// resolvers are consulted, in order, before a query is forwarded
+	// upstream. Configure with AddResolver before calling Start.
+	resolvers []Resolver
+
+	// cache, if set by WithCache, is consulted after the local
+	// resolvers and before the query is forwarded upstream.
+	cache *Cache
+}
+
+// Option configures optional DNSServer behavior, applied by
+// NewDNSServer and NewDNSServerWithUpstreams.
+type Option func(*DNSServer)
+
+// WithCache enables an in-memory response cache sized to hold roughly
+// size entries.
+func WithCache(size int) Option {
+	return func(s *DNSServer) {
+		s.cache = NewCache(size)
+	}
 }
 
-func NewDNSServer(addr, forwarderAddr string) *DNSServer {
+func NewDNSServer(addr, forwarderAddr string, opts ...Option) *DNSServer {
 	if forwarderAddr == "" {
 		forwarderAddr = "8.8.8.8:53"
 	}
-	return &DNSServer{
-		addr:          addr,
-		forwarderAddr: forwarderAddr,
-		running:       false,
+	return NewDNSServerWithUpstreams(addr, []UpstreamConfig{{Addr: forwarderAddr}}, opts...)
+}
+
+// NewDNSServerWithUpstreams builds a server that races each query
+// across multiple upstreams instead of forwarding to a single one; see
+// Forwarder.
+func NewDNSServerWithUpstreams(addr string, upstreams []UpstreamConfig, opts ...Option) *DNSServer {
+	s := &DNSServer{
+		addr:      addr,
+		forwarder: NewForwarder(upstreams),
+		running:   false,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
+
+// AddResolver registers a local Resolver (zones, hosts file, etc.) to
+// be consulted before queries are forwarded upstream. It must be
+// called before Start.
+func (s *DNSServer) AddResolver(r Resolver) {
+	s.resolvers = append(s.resolvers, r)
 }
 
 func (s *DNSServer) Start() error {
@@ -37,47 +75,44 @@ func (s *DNSServer) Start() error {
 		return fmt.Errorf("server already running")
 	}
 
-	// Resolve and listen on the server address
-	addr, err := net.ResolveUDPAddr("udp", s.addr)
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
 	if err != nil {
 		return fmt.Errorf("failed to resolve address: %v", err)
 	}
-
-	conn, err := net.ListenUDP("udp", addr)
+	conn, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	s.conn = conn
-
-	// Resolve and dial the forwarder address ONCE
-	forwarderAddr, err := net.ResolveUDPAddr("udp", s.forwarderAddr)
+	tcpAddr, err := net.ResolveTCPAddr("tcp", s.addr)
 	if err != nil {
-		s.conn.Close() // Clean up listener
-		return fmt.Errorf("failed to resolve forwarder address: %v", err)
+		conn.Close()
+		return fmt.Errorf("failed to resolve TCP address: %v", err)
 	}
-
-	forwarderConn, err := net.DialUDP("udp", nil, forwarderAddr)
+	tcpListener, err := net.ListenTCP("tcp", tcpAddr)
 	if err != nil {
-		s.conn.Close()
-		return fmt.Errorf("failed to dial forwarder: %v", err)
+		conn.Close()
+		return fmt.Errorf("failed to listen on TCP: %v", err)
 	}
 
-	s.forwarderConn = forwarderConn
+	s.conn = conn
+	s.tcpListener = tcpListener
 
 	s.running = true
-	s.wg.Add(1)
-	go s.serve()
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
 
-	log.Printf("DNS Server listening on %s, forwarding to %s", s.addr, s.forwarderAddr)
+	log.Printf("DNS Server listening on %s (UDP+TCP), forwarding to %v", s.addr, s.forwarder.addrs())
 	return nil
 }
 
-func (s *DNSServer) serve() {
+// serveUDP answers queries arriving as single UDP datagrams.
+func (s *DNSServer) serveUDP() {
 	defer s.wg.Done()
 
 	for s.isRunning() {
-		buf := make([]byte, 512)
+		buf := make([]byte, MaxUDPMessageSize)
 		s.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
 		n, remoteAddr, err := s.conn.ReadFromUDP(buf)
 
@@ -92,47 +127,213 @@ func (s *DNSServer) serve() {
 			continue
 		}
 
-		go s.handleQuery(buf[:n], remoteAddr)
+		go s.handleQuery(buf[:n], udpClientTransport{conn: s.conn, addr: remoteAddr})
 	}
 }
 
-func (s *DNSServer) forwardQuery(query []byte) ([]byte, error) {
-	conn := s.forwarderConn
-	if conn == nil {
-		return nil, fmt.Errorf("forwarder connection is not available")
+// serveTCP answers queries arriving over TCP, each framed with a
+// 2-byte length prefix (RFC 1035 section 4.2.2): the same framing
+// TCPUpstream uses to talk to upstream servers.
+func (s *DNSServer) serveTCP() {
+	defer s.wg.Done()
+
+	for s.isRunning() {
+		s.tcpListener.SetDeadline(time.Now().Add(100 * time.Millisecond))
+		conn, err := s.tcpListener.Accept()
+
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			if !s.isRunning() {
+				return
+			}
+			log.Printf("Accept error: %v", err)
+			continue
+		}
+
+		go s.handleTCPConn(conn)
 	}
+}
 
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
+// handleTCPConn reads the single framed query a TCP client sent,
+// answers it, and closes the connection.
+func (s *DNSServer) handleTCPConn(conn net.Conn) {
+	defer conn.Close()
 
-	_, err := conn.Write(query)
+	conn.SetDeadline(time.Now().Add(defaultForwardTimeout))
+	query, err := readFramed(conn)
 	if err != nil {
-		return nil, err
+		return
 	}
+	s.handleQuery(query, tcpClientTransport{conn: conn})
+}
 
-	response := make([]byte, 512)
-	n, err := conn.Read(response)
-	if err != nil {
-		return nil, err
+func (s *DNSServer) forwardQuery(query []byte) ([]byte, error) {
+	return s.forwarder.Forward(query)
+}
+
+func (s *DNSServer) handleQuery(query []byte, client clientTransport) {
+	msg, err := ParseDNSMessage(query)
+	if err != nil || len(msg.Questions) == 0 {
+		s.forwardAndRespond(query, client, 0)
+		return
+	}
+	question := msg.Questions[0]
+
+	var ednsUDPSize uint16
+	if opt := msg.EDNS0(); opt != nil {
+		ednsUDPSize = opt.UDPSize
+	}
+
+	if response, ok := s.resolveLocally(msg, question); ok {
+		s.deliver(response, client, ednsUDPSize)
+		return
+	}
+
+	if s.cache != nil {
+		if response, ok := s.cache.Get(question, msg.Header.ID); ok {
+			s.deliver(response, client, ednsUDPSize)
+			return
+		}
 	}
 
-	return response[:n], nil
+	s.forwardAndRespond(query, client, ednsUDPSize)
 }
 
-func (s *DNSServer) handleQuery(query []byte, remoteAddr *net.UDPAddr) {
+func (s *DNSServer) forwardAndRespond(query []byte, client clientTransport, ednsUDPSize uint16) {
 	response, err := s.forwardQuery(query)
 	if err != nil {
 		log.Printf("Forward error: %v", err)
 		return
 	}
 
-	if s.conn != nil {
-		_, err = s.conn.WriteToUDP(response, remoteAddr)
+	if s.cache != nil {
+		if reply, err := ParseDNSMessage(response); err == nil {
+			s.cache.Set(response, reply)
+		}
+	}
+
+	s.deliver(response, client, ednsUDPSize)
+}
+
+// resolveLocally answers question from the configured resolvers, if
+// any of them claims it. It returns the packed response and true on a
+// match, including a synthesized NXDOMAIN for blocked names.
+func (s *DNSServer) resolveLocally(msg *DNSMessage, question DNSQuestion) ([]byte, bool) {
+	for _, r := range s.resolvers {
+		answers, matched := r.Lookup(question)
+		if !matched {
+			continue
+		}
+
+		response := synthesizeResponse(msg, answers)
+		packed, err := response.Pack()
 		if err != nil {
-			if s.isRunning() {
-				log.Printf("Response error: %v", err)
-			}
+			log.Printf("Failed to pack local response for %s: %v", question.Name, err)
+			return nil, false
 		}
+		return packed, true
+	}
+	return nil, false
+}
+
+// synthesizeResponse builds a response to query carrying answers,
+// setting NXDOMAIN when there are none (a blocklisted name).
+func synthesizeResponse(query *DNSMessage, answers []DNSRecord) *DNSMessage {
+	response := &DNSMessage{
+		Header: DNSHeader{
+			ID:      query.Header.ID,
+			Flags:   FlagResponse | FlagRecursionAvailable,
+			QDCount: query.Header.QDCount,
+			ANCount: uint16(len(answers)),
+		},
+		Questions: query.Questions,
+		Answers:   answers,
+	}
+	if len(answers) == 0 {
+		response.Header.Flags |= RCodeNXDomain
+	}
+	if opt := query.EDNS0(); opt != nil {
+		response.SetEDNS0(MaxUDPMessageSize, false)
 	}
+	return response
+}
+
+// clientTransport delivers a response back to whatever sent the
+// query: a single UDP datagram addressed to the sender, or a
+// length-prefixed write on an already-accepted TCP connection.
+type clientTransport interface {
+	// maxResponseSize returns the largest response this transport can
+	// carry without truncation, given the query's own EDNS0 UDP size
+	// (0 if it carried none). TCP has no such limit, so it returns 0.
+	maxResponseSize(ednsUDPSize uint16) int
+	respond(data []byte) error
+}
+
+type udpClientTransport struct {
+	conn *net.UDPConn
+	addr *net.UDPAddr
+}
+
+func (t udpClientTransport) maxResponseSize(ednsUDPSize uint16) int {
+	if ednsUDPSize > 0 {
+		return int(ednsUDPSize)
+	}
+	return DefaultUDPBufferSize
+}
+
+func (t udpClientTransport) respond(data []byte) error {
+	_, err := t.conn.WriteToUDP(data, t.addr)
+	return err
+}
+
+type tcpClientTransport struct {
+	conn net.Conn
+}
+
+func (t tcpClientTransport) maxResponseSize(ednsUDPSize uint16) int {
+	return 0
+}
+
+func (t tcpClientTransport) respond(data []byte) error {
+	return writeFramed(t.conn, data)
+}
+
+// deliver sends response to client, substituting a minimal,
+// truncated (TC-bit-set) reply if it's larger than client can carry,
+// so a UDP client knows to retry the query over TCP.
+func (s *DNSServer) deliver(response []byte, client clientTransport, ednsUDPSize uint16) {
+	if max := client.maxResponseSize(ednsUDPSize); max > 0 && len(response) > max {
+		if truncated, err := truncatedResponse(response); err == nil {
+			response = truncated
+		}
+	}
+	if err := client.respond(response); err != nil {
+		if s.isRunning() {
+			log.Printf("Response error: %v", err)
+		}
+	}
+}
+
+// truncatedResponse rebuilds wire as a minimal reply carrying no
+// answer, authority, or additional records, with the TC bit set
+// (RFC 1035 section 4.1.1).
+func truncatedResponse(wire []byte) ([]byte, error) {
+	msg, err := ParseDNSMessage(wire)
+	if err != nil {
+		return nil, err
+	}
+
+	truncated := &DNSMessage{
+		Header: DNSHeader{
+			ID:      msg.Header.ID,
+			Flags:   msg.Header.Flags | FlagTruncated,
+			QDCount: msg.Header.QDCount,
+		},
+		Questions: msg.Questions,
+	}
+	return truncated.Pack()
 }
 
 func (s *DNSServer) isRunning() bool {
@@ -157,16 +358,16 @@ func (s *DNSServer) Stop() error {
 	}
 	s.running = false
 	conn := s.conn
-	forwarderConn := s.forwarderConn // Get the forwarder connection
+	tcpListener := s.tcpListener
 	s.mu.Unlock()
 
 	if conn != nil {
 		conn.Close()
 	}
-	if forwarderConn != nil {
-		forwarderConn.Close() // Close the forwarder connection
+	if tcpListener != nil {
+		tcpListener.Close()
 	}
 
 	s.wg.Wait()
-	return nil
+	return s.forwarder.Close()
 }
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -71,6 +72,92 @@ func TestServerForwarding(t *testing.T) {
 	require.True(t, bytes.Equal(responseBytes, respBuf[:n]), "The response from the server should match the mock forwarder's response")
 }
 
+func TestServerServesTCP(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	zones := NewZoneStore()
+	zones.AddA("tcp.example.com", 300, net.ParseIP("10.0.0.9"))
+
+	server := NewDNSServer("127.0.0.1:0", "")
+	server.AddResolver(zones)
+	require.NoError(t, server.Start())
+	t.Cleanup(func() { server.Stop() })
+
+	query := &DNSMessage{
+		Header:    DNSHeader{ID: 7, QDCount: 1, Flags: FlagRecursionDesired},
+		Questions: []DNSQuestion{{Name: "tcp.example.com", Type: QTypeA, Class: QClassIN}},
+	}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", server.tcpListener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, writeFramed(conn, queryBytes))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	respBytes, err := readFramed(conn)
+	require.NoError(t, err)
+
+	response, err := ParseDNSMessage(respBytes)
+	require.NoError(t, err)
+	require.Len(t, response.Answers, 1)
+	require.True(t, net.IP(response.Answers[0].RData).Equal(net.ParseIP("10.0.0.9")))
+}
+
+func TestServerTruncatesOversizedUDPResponseAndTCPFallbackReturnsFull(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	zones := NewZoneStore()
+	for i := 0; i < 20; i++ {
+		zones.AddTXT("big.example.com", 300, strings.Repeat("x", 60))
+	}
+
+	server := NewDNSServer("127.0.0.1:0", "")
+	server.AddResolver(zones)
+	require.NoError(t, server.Start())
+	t.Cleanup(func() { server.Stop() })
+
+	query := &DNSMessage{
+		Header:    DNSHeader{ID: 8, QDCount: 1, Flags: FlagRecursionDesired},
+		Questions: []DNSQuestion{{Name: "big.example.com", Type: QTypeTXT, Class: QClassIN}},
+	}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	udpConn, err := net.Dial("udp", server.conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udpConn.Close()
+
+	_, err = udpConn.Write(queryBytes)
+	require.NoError(t, err)
+
+	respBuf := make([]byte, MaxUDPMessageSize)
+	udpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := udpConn.Read(respBuf)
+	require.NoError(t, err)
+
+	udpResponse, err := ParseDNSMessage(respBuf[:n])
+	require.NoError(t, err)
+	require.NotZero(t, udpResponse.Header.Flags&FlagTruncated)
+	require.Empty(t, udpResponse.Answers)
+
+	tcpConn, err := net.Dial("tcp", server.tcpListener.Addr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+
+	require.NoError(t, writeFramed(tcpConn, queryBytes))
+	tcpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	tcpRespBytes, err := readFramed(tcpConn)
+	require.NoError(t, err)
+
+	tcpResponse, err := ParseDNSMessage(tcpRespBytes)
+	require.NoError(t, err)
+	require.Len(t, tcpResponse.Answers, 20)
+}
+
 func BenchmarkServerE2E(b *testing.B) {
 	log.SetOutput(io.Discard)
 	b.Cleanup(func() { log.SetOutput(os.Stderr) })
@@ -0,0 +1,410 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upstream is a single DNS transport: something that can exchange a
+// raw wire-format query for a raw wire-format response.
+type Upstream interface {
+	Exchange(ctx context.Context, query []byte) ([]byte, error)
+	Close() error
+}
+
+// NewUpstream builds an Upstream for addr, dispatching on URL scheme
+// the way AdGuard's upstream.AddressToUpstream does: a bare
+// "host:port" (no scheme) means plain UDP, and "udp://", "tcp://",
+// "tls://" (DNS-over-TLS) and "https://" (DNS-over-HTTPS) select the
+// matching transport.
+func NewUpstream(addr string) (Upstream, error) {
+	scheme, rest, hasScheme := strings.Cut(addr, "://")
+	if !hasScheme {
+		return NewUDPUpstream(addr), nil
+	}
+
+	switch scheme {
+	case "udp":
+		return NewUDPUpstream(rest), nil
+	case "tcp":
+		return NewTCPUpstream(rest), nil
+	case "tls":
+		return NewDoTUpstream(rest), nil
+	case "https":
+		return NewDoHUpstream(addr), nil
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme %q", scheme)
+	}
+}
+
+// erroringUpstream always fails; it stands in for an upstream whose
+// address couldn't be turned into a transport.
+type erroringUpstream struct{ err error }
+
+func (e erroringUpstream) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	return nil, e.err
+}
+func (e erroringUpstream) Close() error { return nil }
+
+// UDPUpstream exchanges queries over plain UDP, dialing a fresh
+// connection per query. A truncated (TC=1) reply is transparently
+// retried over TCP to the same address.
+type UDPUpstream struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+// NewUDPUpstream builds a UDPUpstream targeting addr ("host:port").
+func NewUDPUpstream(addr string) *UDPUpstream {
+	return &UDPUpstream{Addr: addr, Timeout: defaultForwardTimeout}
+}
+
+// Exchange implements Upstream.
+func (u *UDPUpstream) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	raddr, err := net.ResolveUDPAddr("udp", u.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(deadline(ctx, u.Timeout))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, MaxUDPMessageSize)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if isTruncated(resp[:n]) {
+		return NewTCPUpstream(u.Addr).Exchange(ctx, query)
+	}
+	return resp[:n], nil
+}
+
+// Close implements Upstream.
+func (u *UDPUpstream) Close() error { return nil }
+
+func isTruncated(resp []byte) bool {
+	if len(resp) < 4 {
+		return false
+	}
+	flags := binary.BigEndian.Uint16(resp[2:4])
+	return flags&FlagTruncated != 0
+}
+
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	d := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(d) {
+		return ctxDeadline
+	}
+	return d
+}
+
+// TCPUpstream exchanges queries over plain TCP, using the 2-byte
+// length-prefixed framing from RFC 1035 section 4.2.2.
+type TCPUpstream struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+// NewTCPUpstream builds a TCPUpstream targeting addr ("host:port").
+func NewTCPUpstream(addr string) *TCPUpstream {
+	return &TCPUpstream{Addr: addr, Timeout: defaultForwardTimeout}
+}
+
+// Exchange implements Upstream.
+func (u *TCPUpstream) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: u.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", u.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(deadline(ctx, u.Timeout))
+	if err := writeFramed(conn, query); err != nil {
+		return nil, err
+	}
+	return readFramed(conn)
+}
+
+// Close implements Upstream.
+func (u *TCPUpstream) Close() error { return nil }
+
+// writeFramed writes query behind a 2-byte big-endian length prefix,
+// the framing DNS-over-TCP and DNS-over-TLS share.
+func writeFramed(w io.Writer, query []byte) error {
+	if len(query) > 0xFFFF {
+		return fmt.Errorf("query too large for TCP framing: %d bytes", len(query))
+	}
+
+	var lenBuf [2]byte
+	binary.BigEndian.PutUint16(lenBuf[:], uint16(len(query)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(query)
+	return err
+}
+
+// readFramed reads one 2-byte-length-prefixed message from r.
+func readFramed(r io.Reader) ([]byte, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(r, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// DoTUpstream is a DNS-over-TLS (RFC 7858) transport: a single
+// persistent, keepalive TLS connection pipelining concurrent queries,
+// demultiplexed by DNS message ID.
+type DoTUpstream struct {
+	addr      string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+
+	mu      sync.Mutex
+	conn    *tls.Conn
+	pending map[uint16]chan []byte
+	closed  bool
+}
+
+// NewDoTUpstream builds a DoTUpstream targeting addr ("host:port" or
+// bare "host", which defaults to port 853).
+func NewDoTUpstream(addr string) *DoTUpstream {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		addr = net.JoinHostPort(addr, "853")
+	}
+	return &DoTUpstream{
+		addr:      addr,
+		tlsConfig: &tls.Config{ServerName: host},
+		timeout:   defaultForwardTimeout,
+		pending:   make(map[uint16]chan []byte),
+	}
+}
+
+// Exchange implements Upstream.
+func (u *DoTUpstream) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) < 2 {
+		return nil, fmt.Errorf("query too short")
+	}
+	id := binary.BigEndian.Uint16(query[0:2])
+
+	conn, err := u.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []byte, 1)
+	u.mu.Lock()
+	u.pending[id] = ch
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		delete(u.pending, id)
+		u.mu.Unlock()
+	}()
+
+	u.mu.Lock()
+	writeErr := writeFramed(conn, query)
+	u.mu.Unlock()
+	if writeErr != nil {
+		u.dropConnection(conn)
+		return nil, writeErr
+	}
+
+	timer := time.NewTimer(u.timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("DoT exchange to %s timed out", u.addr)
+	}
+}
+
+// connection returns the shared TLS connection, dialing and starting
+// its read-dispatch loop on first use or after a prior failure.
+func (u *DoTUpstream) connection() (*tls.Conn, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.closed {
+		return nil, fmt.Errorf("upstream closed")
+	}
+	if u.conn != nil {
+		return u.conn, nil
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: u.timeout, KeepAlive: 30 * time.Second}, "tcp", u.addr, u.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	u.conn = conn
+	go u.readLoop(conn)
+	return conn, nil
+}
+
+// readLoop demultiplexes pipelined responses by DNS message ID,
+// handing each to the channel its Exchange call is waiting on.
+func (u *DoTUpstream) readLoop(conn *tls.Conn) {
+	for {
+		resp, err := readFramed(conn)
+		if err != nil {
+			u.dropConnection(conn)
+			return
+		}
+		if len(resp) < 2 {
+			continue
+		}
+		id := binary.BigEndian.Uint16(resp[0:2])
+
+		u.mu.Lock()
+		ch, ok := u.pending[id]
+		u.mu.Unlock()
+		if ok {
+			select {
+			case ch <- resp:
+			default:
+			}
+		}
+	}
+}
+
+func (u *DoTUpstream) dropConnection(conn *tls.Conn) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.conn == conn {
+		conn.Close()
+		u.conn = nil
+	}
+}
+
+// Close implements Upstream.
+func (u *DoTUpstream) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+	if u.conn != nil {
+		err := u.conn.Close()
+		u.conn = nil
+		return err
+	}
+	return nil
+}
+
+// DoHUpstream is a DNS-over-HTTPS (RFC 8484) transport: an HTTP/2 POST
+// of the wire-format query, honoring the response's Cache-Control
+// max-age as a minimum TTL floor.
+type DoHUpstream struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoHUpstream builds a DoHUpstream posting to the given URL (e.g.
+// "https://dns.google/dns-query").
+func NewDoHUpstream(url string) *DoHUpstream {
+	return &DoHUpstream{
+		url:    url,
+		client: &http.Client{Timeout: defaultForwardTimeout},
+	}
+}
+
+// Exchange implements Upstream.
+func (u *DoHUpstream) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH upstream %s returned status %d", u.url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	if maxAge, ok := parseMaxAge(resp.Header.Get("Cache-Control")); ok {
+		body = applyMinTTL(body, maxAge)
+	}
+	return body, nil
+}
+
+// Close implements Upstream.
+func (u *DoHUpstream) Close() error {
+	u.client.CloseIdleConnections()
+	return nil
+}
+
+// parseMaxAge extracts the max-age directive (in seconds) from an
+// HTTP Cache-Control header value.
+func parseMaxAge(cacheControl string) (uint32, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		seconds, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			continue
+		}
+		return uint32(seconds), true
+	}
+	return 0, false
+}
+
+// applyMinTTL raises any record's TTL up to floor, patching the TTL
+// fields directly on wire rather than parsing and re-Packing the
+// message: re-Packing would re-run owner-name compression and could
+// invalidate a compression pointer embedded in some record's RDATA. If
+// wire doesn't parse, it is returned unchanged.
+func applyMinTTL(wire []byte, floor uint32) []byte {
+	raised, err := adjustWireTTLs(wire, func(ttl uint32) uint32 {
+		if ttl < floor {
+			return floor
+		}
+		return ttl
+	})
+	if err != nil {
+		return wire
+	}
+	return raised
+}
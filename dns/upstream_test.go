@@ -0,0 +1,143 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUpstreamDispatchesByScheme(t *testing.T) {
+	u, err := NewUpstream("8.8.8.8:53")
+	require.NoError(t, err)
+	require.IsType(t, &UDPUpstream{}, u)
+
+	u, err = NewUpstream("udp://8.8.8.8:53")
+	require.NoError(t, err)
+	require.IsType(t, &UDPUpstream{}, u)
+
+	u, err = NewUpstream("tcp://8.8.8.8:53")
+	require.NoError(t, err)
+	require.IsType(t, &TCPUpstream{}, u)
+
+	u, err = NewUpstream("tls://1.1.1.1:853")
+	require.NoError(t, err)
+	require.IsType(t, &DoTUpstream{}, u)
+
+	u, err = NewUpstream("https://dns.google/dns-query")
+	require.NoError(t, err)
+	require.IsType(t, &DoHUpstream{}, u)
+
+	_, err = NewUpstream("quic://1.1.1.1:853")
+	require.Error(t, err)
+}
+
+func TestUDPUpstreamExchange(t *testing.T) {
+	query := &DNSMessage{Header: DNSHeader{ID: 99, QDCount: 1}, Questions: []DNSQuestion{{Name: "test.com", Type: QTypeA, Class: QClassIN}}}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	response := &DNSMessage{Header: DNSHeader{ID: 99, ANCount: 1, Flags: FlagResponse}, Answers: []DNSRecord{{Name: "test.com", RData: []byte{9, 9, 9, 9}}}}
+	responseBytes, err := response.Pack()
+	require.NoError(t, err)
+
+	addr := mockForwarderWithDelay(t, responseBytes, 0)
+
+	u := NewUDPUpstream(addr.String())
+	resp, err := u.Exchange(context.Background(), queryBytes)
+	require.NoError(t, err)
+	require.Equal(t, responseBytes, resp)
+}
+
+func TestTCPUpstreamExchange(t *testing.T) {
+	query := &DNSMessage{Header: DNSHeader{ID: 100, QDCount: 1}, Questions: []DNSQuestion{{Name: "test.com", Type: QTypeA, Class: QClassIN}}}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	response := &DNSMessage{Header: DNSHeader{ID: 100, ANCount: 1, Flags: FlagResponse}, Answers: []DNSRecord{{Name: "test.com", RData: []byte{1, 2, 3, 4}}}}
+	responseBytes, err := response.Pack()
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := readFramed(conn)
+		if err != nil || len(req) == 0 {
+			return
+		}
+		writeFramed(conn, responseBytes)
+	}()
+
+	u := NewTCPUpstream(ln.Addr().String())
+	resp, err := u.Exchange(context.Background(), queryBytes)
+	require.NoError(t, err)
+	require.Equal(t, responseBytes, resp)
+}
+
+func TestDoHUpstreamAppliesMinTTLFromCacheControl(t *testing.T) {
+	response := &DNSMessage{
+		Header: DNSHeader{ID: 1, ANCount: 1, Flags: FlagResponse},
+		Answers: []DNSRecord{
+			{Name: "test.com", Type: QTypeA, Class: QClassIN, TTL: 10, RDLength: 4, RData: []byte{1, 1, 1, 1}},
+		},
+	}
+	responseBytes, err := response.Pack()
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(responseBytes)
+	}))
+	t.Cleanup(server.Close)
+
+	u := NewDoHUpstream(server.URL)
+	query := &DNSMessage{Header: DNSHeader{ID: 1, QDCount: 1}, Questions: []DNSQuestion{{Name: "test.com", Type: QTypeA, Class: QClassIN}}}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	resp, err := u.Exchange(context.Background(), queryBytes)
+	require.NoError(t, err)
+
+	parsed, err := ParseDNSMessage(resp)
+	require.NoError(t, err)
+	require.Len(t, parsed.Answers, 1)
+	require.Equal(t, uint32(3600), parsed.Answers[0].TTL)
+}
+
+func TestParseMaxAge(t *testing.T) {
+	age, ok := parseMaxAge("public, max-age=120")
+	require.True(t, ok)
+	require.Equal(t, uint32(120), age)
+
+	_, ok = parseMaxAge("no-store")
+	require.False(t, ok)
+}
+
+func TestDoTUpstreamExchangeFailsFastWhenUnreachable(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	require.NoError(t, err)
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	require.NoError(t, conn.Close())
+
+	u := NewDoTUpstream(addr.String())
+	u.timeout = 500 * time.Millisecond
+
+	query := &DNSMessage{Header: DNSHeader{ID: 1, QDCount: 1}, Questions: []DNSQuestion{{Name: "test.com", Type: QTypeA, Class: QClassIN}}}
+	queryBytes, err := query.Pack()
+	require.NoError(t, err)
+
+	_, err = u.Exchange(context.Background(), queryBytes)
+	require.Error(t, err)
+}